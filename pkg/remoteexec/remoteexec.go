@@ -0,0 +1,109 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package remoteexec builds shell-correct command strings for the handful
+// of remote shells wsh needs to drive over a plain stdin/stdout pipe (WSL,
+// cmd.exe, PowerShell, and eventually others). It replaces ad hoc one-liner
+// probes like `echo %OS%` or `echo $env:OS` scattered across callers with a
+// single Shell interface that knows how to quote arguments, resolve
+// executables on PATH, and read environment variables for its own dialect.
+package remoteexec
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Exec runs cmdStr on the remote and returns its trimmed stdout. Callers
+// supply this so remoteexec stays decoupled from any particular transport
+// (WSL, SSH, etc.) — it only needs to run a string and read the result.
+type Exec func(ctx context.Context, cmdStr string) (string, error)
+
+// Shell knows how to build command fragments that are valid for one
+// specific remote shell dialect.
+type Shell interface {
+	// Name identifies the shell for logging.
+	Name() string
+	// Quote escapes s so it is safe to pass as a single argument.
+	Quote(s string) string
+	// EnvVar returns the expression that reads environment variable name.
+	EnvVar(name string) string
+	// ResolveCommand returns a command line that prints the absolute path
+	// to name if it's on PATH, and nothing (a non-zero exit) otherwise.
+	ResolveCommand(name string) string
+}
+
+// Bash implements Shell for bash and other POSIX-ish shells (sh, zsh, etc.
+// share the same quoting and env var syntax).
+type Bash struct{}
+
+func (Bash) Name() string { return "bash" }
+
+func (Bash) Quote(s string) string {
+	// wrap in single quotes, escaping any embedded single quotes the
+	// standard POSIX way: close the quote, emit an escaped quote, reopen
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func (Bash) EnvVar(name string) string {
+	return "$" + name
+}
+
+func (b Bash) ResolveCommand(name string) string {
+	return "which " + b.Quote(name)
+}
+
+// Cmd implements Shell for Windows' cmd.exe.
+type Cmd struct{}
+
+func (Cmd) Name() string { return "cmd" }
+
+func (Cmd) Quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func (Cmd) EnvVar(name string) string {
+	return "%" + name + "%"
+}
+
+func (c Cmd) ResolveCommand(name string) string {
+	return "where " + c.Quote(name)
+}
+
+// Powershell implements Shell for both Windows PowerShell and pwsh.
+type Powershell struct{}
+
+func (Powershell) Name() string { return "powershell" }
+
+func (Powershell) Quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+func (Powershell) EnvVar(name string) string {
+	return "$Env:" + name
+}
+
+func (p Powershell) ResolveCommand(name string) string {
+	return "(Get-Command " + p.Quote(name) + ").Source"
+}
+
+// DetectShell probes the remote, in order of cheapest/most-common first,
+// to find which Shell dialect is on the other end of exec. It replaces the
+// old IsPowershell(shellPath string) bool heuristic, which only worked once
+// you already had a shell path string to inspect.
+func DetectShell(ctx context.Context, exec Exec) (Shell, error) {
+	if out, err := exec(ctx, "echo $0"); err == nil && strings.TrimSpace(out) != "" && !strings.Contains(out, "$0") {
+		return Bash{}, nil
+	}
+
+	if out, err := exec(ctx, "echo %OS%"); err == nil && strings.TrimSpace(out) != "%OS%" {
+		return Cmd{}, nil
+	}
+
+	if out, err := exec(ctx, "echo $Env:OS"); err == nil && strings.TrimSpace(out) != "$Env:OS" {
+		return Powershell{}, nil
+	}
+
+	return nil, fmt.Errorf("unable to detect remote shell")
+}
@@ -0,0 +1,150 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshclient
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"github.com/wavetermdev/thenextwave/pkg/wshrpc"
+	"github.com/wavetermdev/thenextwave/pkg/wshutil"
+)
+
+// BroadcastResult pairs one peer's response to a BroadcastRpc call with the
+// client it came from, since fan-out callers need to know who answered
+// (and who didn't) rather than just the response values.
+type BroadcastResult[T any] struct {
+	Client   *wshutil.WshRpc
+	Response T
+	Error    error
+}
+
+// BroadcastRpc issues command to every client in clients concurrently,
+// bounded by opts.Concurrency (all at once if unset), and streams each
+// peer's result back as it arrives. Cancelling ctx stops issuing new
+// requests, aborts any request already in flight (see broadcastOne), and
+// unblocks any goroutines waiting to send a result that nobody is reading
+// anymore. This replaces the open-coded goroutine and channel plumbing
+// callers previously had to write around sendRpcRequestCallHelper for "do
+// this on every distro" operations.
+func BroadcastRpc[T any](ctx context.Context, clients []*wshutil.WshRpc, command string, data any, opts *wshrpc.RpcOpts) <-chan BroadcastResult[T] {
+	if opts == nil {
+		opts = &wshrpc.RpcOpts{}
+	}
+	resultChan := make(chan BroadcastResult[T])
+
+	concurrency := opts.Concurrency
+	if concurrency <= 0 {
+		concurrency = len(clients)
+	}
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	sem := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, client := range clients {
+		client := client
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				sendBroadcastResult(ctx, resultChan, BroadcastResult[T]{Client: client, Error: ctx.Err()})
+				return
+			}
+
+			resp, err := broadcastOne[T](ctx, client, command, data, opts)
+			sendBroadcastResult(ctx, resultChan, BroadcastResult[T]{Client: client, Response: resp, Error: err})
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(resultChan)
+	}()
+
+	return resultChan
+}
+
+// broadcastOne issues a single request to client and genuinely aborts it if
+// ctx is cancelled before a response arrives. sendRpcRequestCallHelper
+// can't do that — it takes no context at all, so a cancelled ctx only ever
+// stops BroadcastRpc from waiting on the result, not the peer from still
+// working on it. Routing through StreamRequest instead means cancellation
+// calls reqHandler.Cancel(), which actually tells the peer to stop.
+func broadcastOne[T any](ctx context.Context, client *wshutil.WshRpc, command string, data any, opts *wshrpc.RpcOpts) (T, error) {
+	var zero T
+	stream, err := StreamRequest[T](client, command, data, opts)
+	if err != nil {
+		return zero, err
+	}
+	defer stream.Close()
+
+	watchDone := make(chan struct{})
+	defer close(watchDone)
+	go func() {
+		select {
+		case <-ctx.Done():
+			stream.Close()
+		case <-watchDone:
+		}
+	}()
+
+	return stream.Recv(ctx)
+}
+
+// sendBroadcastResult sends res on resultChan unless ctx is already done,
+// so a cancelled fan-out doesn't leave goroutines blocked on a send that a
+// caller (e.g. First) has stopped draining.
+func sendBroadcastResult[T any](ctx context.Context, resultChan chan BroadcastResult[T], res BroadcastResult[T]) {
+	select {
+	case resultChan <- res:
+	case <-ctx.Done():
+	}
+}
+
+// First issues command to every client in clients and returns the first
+// successful response, cancelling the rest as soon as one arrives. If none
+// succeed, it returns the last error observed.
+func First[T any](ctx context.Context, clients []*wshutil.WshRpc, command string, data any, opts *wshrpc.RpcOpts) (T, error) {
+	var zero T
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := BroadcastRpc[T](ctx, clients, command, data, opts)
+	var lastErr error
+	for res := range results {
+		if res.Error == nil {
+			cancel()
+			go func() {
+				for range results {
+				}
+			}()
+			return res.Response, nil
+		}
+		lastErr = res.Error
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no clients given to wshclient.First")
+	}
+	return zero, lastErr
+}
+
+// Gather issues command to every client in clients and waits for all of
+// them to finish, splitting the results into successes and errors.
+func Gather[T any](ctx context.Context, clients []*wshutil.WshRpc, command string, data any, opts *wshrpc.RpcOpts) (successes []BroadcastResult[T], errs []BroadcastResult[T]) {
+	for res := range BroadcastRpc[T](ctx, clients, command, data, opts) {
+		if res.Error != nil {
+			errs = append(errs, res)
+		} else {
+			successes = append(successes, res)
+		}
+	}
+	return successes, errs
+}
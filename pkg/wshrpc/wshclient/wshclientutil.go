@@ -4,13 +4,20 @@
 package wshclient
 
 import (
+	"context"
 	"errors"
+	"io"
+	"sync"
+	"time"
 
 	"github.com/wavetermdev/thenextwave/pkg/util/utilfn"
 	"github.com/wavetermdev/thenextwave/pkg/wshrpc"
 	"github.com/wavetermdev/thenextwave/pkg/wshutil"
 )
 
+// defaultStreamBufferSize is used when RpcOpts.StreamBufferSize is unset (zero).
+const defaultStreamBufferSize = 32
+
 func sendRpcRequestCallHelper[T any](w *wshutil.WshRpc, command string, data interface{}, opts *wshrpc.RpcOpts) (T, error) {
 	if opts == nil {
 		opts = &wshrpc.RpcOpts{}
@@ -37,47 +44,163 @@ func sendRpcRequestCallHelper[T any](w *wshutil.WshRpc, command string, data int
 	return respData, nil
 }
 
-func rtnErr[T any](ch chan wshrpc.RespOrErrorUnion[T], err error) {
-	go func() {
-		ch <- wshrpc.RespOrErrorUnion[T]{Error: err}
-		close(ch)
-	}()
+// Stream is a typed, cancellable handle on a streaming RPC response. A
+// Stream can be told to stop: cancelling the context passed to Recv, or
+// calling Close directly, cancels the underlying reqHandler instead of
+// leaving it blocked forever trying to send into a channel nobody is
+// draining.
+type Stream[T any] struct {
+	reqHandler wshutil.RequestHandler
+	respChan   chan wshrpc.RespOrErrorUnion[T]
+	closed     chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// Recv blocks until the next response arrives, the stream ends normally,
+// or ctx is done. Normal end of stream is reported as (zero, io.EOF).
+func (s *Stream[T]) Recv(ctx context.Context) (T, error) {
+	var zero T
+	select {
+	case resp, ok := <-s.respChan:
+		if !ok {
+			return zero, io.EOF
+		}
+		if resp.Error != nil {
+			return zero, resp.Error
+		}
+		return resp.Response, nil
+	case <-s.closed:
+		return zero, io.EOF
+	case <-ctx.Done():
+		s.Close()
+		return zero, ctx.Err()
+	}
+}
+
+// Close cancels the in-flight RPC request, unblocking the background
+// goroutine and releasing reqHandler. Safe to call more than once, and
+// safe to call after Recv has already observed end of stream.
+func (s *Stream[T]) Close() error {
+	var err error
+	s.closeOnce.Do(func() {
+		err = s.reqHandler.Cancel()
+		close(s.closed)
+	})
+	return err
 }
 
-func sendRpcRequestResponseStreamHelper[T any](w *wshutil.WshRpc, command string, data interface{}, opts *wshrpc.RpcOpts) chan wshrpc.RespOrErrorUnion[T] {
+// StreamRequest issues command as a streaming RPC call and returns a typed
+// Stream instead of a bare channel. opts.StreamBufferSize sizes the
+// internal channel (defaultStreamBufferSize when unset). If opts.Timeout is
+// set, the stream is force-closed (reqHandler.Cancel()'d) once it elapses,
+// the same way a unary call's deadline aborts it. The background goroutine
+// that pumps reqHandler into the channel selects on Close, so a consumer
+// that stops calling Recv no longer leaks the request.
+func StreamRequest[T any](w *wshutil.WshRpc, command string, data interface{}, opts *wshrpc.RpcOpts) (*Stream[T], error) {
 	if opts == nil {
 		opts = &wshrpc.RpcOpts{}
 	}
-	respChan := make(chan wshrpc.RespOrErrorUnion[T])
 	if w == nil {
-		rtnErr(respChan, errors.New("nil wshrpc passed to wshclient"))
-		return respChan
+		return nil, errors.New("nil wshrpc passed to wshclient")
 	}
+
+	bufSize := opts.StreamBufferSize
+	if bufSize <= 0 {
+		bufSize = defaultStreamBufferSize
+	}
+
 	reqHandler, err := w.SendComplexRequest(command, data, opts)
 	if err != nil {
-		rtnErr(respChan, err)
-		return respChan
-	} else {
-		go func() {
-			defer close(respChan)
-			for {
-				if reqHandler.ResponseDone() {
-					break
-				}
-				resp, err := reqHandler.NextResponse()
-				if err != nil {
-					respChan <- wshrpc.RespOrErrorUnion[T]{Error: err}
-					break
+		return nil, err
+	}
+
+	stream := &Stream[T]{
+		reqHandler: reqHandler,
+		respChan:   make(chan wshrpc.RespOrErrorUnion[T], bufSize),
+		closed:     make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go func() {
+		defer close(stream.respChan)
+		defer close(stream.done)
+		for {
+			if reqHandler.ResponseDone() {
+				return
+			}
+			resp, respErr := reqHandler.NextResponse()
+			if respErr != nil {
+				select {
+				case stream.respChan <- wshrpc.RespOrErrorUnion[T]{Error: respErr}:
+				case <-stream.closed:
 				}
-				var respData T
-				err = utilfn.ReUnmarshal(&respData, resp)
-				if err != nil {
-					respChan <- wshrpc.RespOrErrorUnion[T]{Error: err}
-					break
+				return
+			}
+			var respData T
+			if respErr = utilfn.ReUnmarshal(&respData, resp); respErr != nil {
+				select {
+				case stream.respChan <- wshrpc.RespOrErrorUnion[T]{Error: respErr}:
+				case <-stream.closed:
 				}
-				respChan <- wshrpc.RespOrErrorUnion[T]{Response: respData}
+				return
+			}
+			select {
+			case stream.respChan <- wshrpc.RespOrErrorUnion[T]{Response: respData}:
+			case <-stream.closed:
+				return
 			}
+		}
+	}()
+
+	if opts.Timeout > 0 {
+		timer := time.AfterFunc(opts.Timeout, func() {
+			stream.Close()
+		})
+		go func() {
+			<-stream.done
+			timer.Stop()
 		}()
 	}
-	return respChan
+
+	return stream, nil
+}
+
+// sendRpcRequestResponseStreamHelper is a thin backwards-compatible adapter
+// over StreamRequest for callers that haven't migrated to the typed Stream
+// API yet. It previously forwarded into an unbuffered channel with no way
+// for an abandoned consumer to signal "stop", so an abandoned caller left
+// the underlying reqHandler blocked forever. This version buffers the
+// outgoing channel the same way Stream itself does, and the forwarding
+// goroutine selects on stream.closed on every send, so closing the stream
+// (directly, or via opts.Timeout) unblocks it instead of leaking. Callers
+// that need to cancel an in-flight call themselves should use
+// StreamRequest directly, since a bare channel has no Close of its own.
+func sendRpcRequestResponseStreamHelper[T any](w *wshutil.WshRpc, command string, data interface{}, opts *wshrpc.RpcOpts) (chan wshrpc.RespOrErrorUnion[T], error) {
+	stream, err := StreamRequest[T](w, command, data, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(chan wshrpc.RespOrErrorUnion[T], cap(stream.respChan))
+	go func() {
+		defer close(out)
+		defer stream.Close()
+		for {
+			select {
+			case resp, ok := <-stream.respChan:
+				if !ok {
+					return
+				}
+				select {
+				case out <- resp:
+				case <-stream.closed:
+					return
+				}
+			case <-stream.closed:
+				return
+			}
+		}
+	}()
+	return out, nil
 }
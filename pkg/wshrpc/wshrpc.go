@@ -0,0 +1,37 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+// Package wshrpc defines the request/response envelope types shared by
+// wshutil.WshRpc and its typed wshclient wrappers.
+package wshrpc
+
+import "time"
+
+// RpcOpts controls how a single wshclient call behaves.
+type RpcOpts struct {
+	// NoResponse skips waiting for a response entirely; the call returns
+	// as soon as the request is sent.
+	NoResponse bool
+
+	// Timeout bounds how long a unary call waits for a response, or how
+	// long a streaming call is allowed to stay open before StreamRequest
+	// force-closes it. Zero means no timeout.
+	Timeout time.Duration
+
+	// StreamBufferSize sizes the internal channel StreamRequest buffers
+	// responses in ahead of the caller's Recv calls. Zero uses
+	// wshclient's own default.
+	StreamBufferSize int
+
+	// Concurrency bounds how many clients BroadcastRpc calls at once.
+	// Zero (or negative) means unbounded — all clients are called
+	// concurrently.
+	Concurrency int
+}
+
+// RespOrErrorUnion carries one streamed response value or the error that
+// ended the stream, so a single typed channel can carry both.
+type RespOrErrorUnion[T any] struct {
+	Response T
+	Error    error
+}
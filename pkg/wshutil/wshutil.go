@@ -0,0 +1,15 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wshutil
+
+// RequestHandler is the per-request handle returned by WshRpc.SendComplexRequest
+// for streaming calls. Cancel sends an RPC-level cancel frame to the peer and
+// unblocks any goroutine waiting in NextResponse; it is safe to call more than
+// once. Implementations of WshRpc must satisfy this for wshclient.StreamRequest
+// to be able to abort an in-flight streaming call.
+type RequestHandler interface {
+	ResponseDone() bool
+	NextResponse() (any, error)
+	Cancel() error
+}
@@ -0,0 +1,358 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wsl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/wavetermdev/thenextwave/pkg/remoteexec"
+)
+
+// CpProgress reports cumulative progress of a CpHostToRemote transfer.
+// BytesTotal is the total size of the source file(s) being copied.
+type CpProgress struct {
+	BytesSent  int64
+	BytesTotal int64
+}
+
+// CpOpts configures a CpHostToRemote call.
+type CpOpts struct {
+	// Progress, if non-nil, receives a CpProgress update for every chunk
+	// written to the remote. The channel is closed when the copy returns,
+	// whether it succeeds, fails, or is skipped via Resume.
+	Progress chan<- CpProgress
+
+	// Resume causes CpHostToRemote to first ask the remote for the sha256
+	// of destPath, and skip the transfer entirely if it already matches
+	// the local source. Only applies to single-file copies: a directory
+	// can't be meaningfully sha256'd as one blob, so Resume is a no-op
+	// when sourcePath is a directory.
+	Resume bool
+}
+
+// wslCmd is the subset of exec.Cmd-shaped behavior CpHostToRemote and
+// renderAndRun need from a command returned by Distro.WslCommand. Defined
+// as an interface, mirroring the StdinPipe/Start/Wait/Output methods
+// already used elsewhere in this package, so tests can substitute a fake
+// without needing a real WSL distro.
+type wslCmd interface {
+	StdinPipe() (io.WriteCloser, error)
+	StdoutPipe() (io.ReadCloser, error)
+	Start() error
+	Wait() error
+	Output() ([]byte, error)
+}
+
+// distroRunner is the subset of *Distro that CpHostToRemote and
+// renderAndRun depend on. *Distro satisfies it structurally.
+type distroRunner interface {
+	WslCommand(ctx context.Context, cmdStr string) wslCmd
+}
+
+// bash is the shell dialect the bootstrap scripts below are written
+// against: they use `command -v`, so whatever runs them needs to be
+// bash/sh-compatible (hasBashInstalled is checked by the caller).
+var bash = remoteexec.Bash{}
+
+// dirExtractSentinel is echoed by bootstrapExtractDirTemplate once
+// extraction succeeds. A directory can't be sha256'd as a single blob the
+// way a file can, so directory copies confirm success this way instead.
+const dirExtractSentinel = "EXTRACT_OK"
+
+// bootstrapExtractFileTemplate is run on the remote side for single-file
+// copies. It extracts the gzip'd tar streamed over stdin into installDir,
+// falling back to busybox or bsdtar when a full tar isn't on the remote's
+// PATH, and echoes the sha256 of the installed file on success so the
+// caller can verify integrity without a second round trip. installDir and
+// installPath are pre-quoted with bash.Quote before being placed in the
+// map passed to Execute, so spaces and shell metacharacters in either are
+// safe.
+var bootstrapExtractFileTemplate = `set -e; \
+mkdir -p {{.installDir}}; \
+if command -v tar >/dev/null 2>&1; then \
+  tar -xzf - -C {{.installDir}}; \
+elif command -v busybox >/dev/null 2>&1; then \
+  busybox tar -xzf - -C {{.installDir}}; \
+elif command -v bsdtar >/dev/null 2>&1; then \
+  bsdtar -xzf - -C {{.installDir}}; \
+else \
+  echo "no-tar-available" >&2; exit 1; \
+fi; \
+chmod a+x {{.installPath}} 2>/dev/null || true; \
+(sha256sum {{.installPath}} 2>/dev/null || shasum -a 256 {{.installPath}} 2>/dev/null) | awk '{print $1}' \
+`
+
+// bootstrapExtractDirTemplate is the directory-copy counterpart: same
+// extraction, but it just confirms success with dirExtractSentinel rather
+// than trying to sha256sum a directory.
+var bootstrapExtractDirTemplate = `set -e; \
+mkdir -p {{.installDir}}; \
+if command -v tar >/dev/null 2>&1; then \
+  tar -xzf - -C {{.installDir}}; \
+elif command -v busybox >/dev/null 2>&1; then \
+  busybox tar -xzf - -C {{.installDir}}; \
+elif command -v bsdtar >/dev/null 2>&1; then \
+  bsdtar -xzf - -C {{.installDir}}; \
+else \
+  echo "no-tar-available" >&2; exit 1; \
+fi; \
+echo ` + dirExtractSentinel + ` \
+`
+
+// remoteSha256Template queries the sha256 of an existing remote file,
+// printing "none" when it doesn't exist, so CpHostToRemote can decide
+// whether a resumed copy can be skipped. installPath is pre-quoted, same
+// as bootstrapExtractFileTemplate.
+var remoteSha256Template = `(sha256sum {{.installPath}} 2>/dev/null || shasum -a 256 {{.installPath}} 2>/dev/null || echo none) | awk '{print $1}'`
+
+// CpHostToRemote streams sourcePath (a file or directory) to destPath on
+// the remote distro as a gzip'd tar archive, extracted by a small
+// bootstrap script run through the remote shell. It replaces the old
+// cat-and-kill approach: the remote process exits on its own once the
+// archive is fully extracted, so cmd.Wait()'s exit code is trustworthy,
+// and (for single-file copies) the remote echoes back a sha256 that is
+// checked against the local file to catch truncated or corrupted
+// transfers.
+func CpHostToRemote(ctx context.Context, client distroRunner, sourcePath string, destPath string, opts *CpOpts) error {
+	if opts == nil {
+		opts = &CpOpts{}
+	}
+	if opts.Progress != nil {
+		defer close(opts.Progress)
+	}
+
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return err
+	}
+	isDir := info.IsDir()
+
+	installDir := filepath.ToSlash(filepath.Dir(destPath))
+	installWords := map[string]string{
+		"installDir":  bash.Quote(installDir),
+		"installPath": bash.Quote(destPath),
+	}
+
+	var localSum string
+	var totalSize int64
+	if isDir {
+		totalSize, err = dirSize(sourcePath)
+		if err != nil {
+			return err
+		}
+	} else {
+		localSum, totalSize, err = hashFile(sourcePath)
+		if err != nil {
+			return err
+		}
+		if opts.Resume {
+			remoteSum, err := renderAndRun(ctx, client, remoteSha256Template, installWords)
+			if err == nil && strings.TrimSpace(remoteSum) == localSum {
+				log.Printf("wsl: %s already present on remote with matching sha256, skipping copy", destPath)
+				return nil
+			}
+		}
+	}
+
+	extractTemplateRaw := bootstrapExtractFileTemplate
+	if isDir {
+		extractTemplateRaw = bootstrapExtractDirTemplate
+	}
+	extractCmd := &bytes.Buffer{}
+	tmpl := template.Must(template.New("").Parse(extractTemplateRaw))
+	if err := tmpl.Execute(extractCmd, installWords); err != nil {
+		return err
+	}
+
+	cmd := client.WslCommand(ctx, extractCmd.String())
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+
+	var stdoutBuf bytes.Buffer
+	stdoutDone := make(chan struct{})
+	go func() {
+		io.Copy(&stdoutBuf, stdout)
+		close(stdoutDone)
+	}()
+
+	gzWriter := gzip.NewWriter(stdin)
+	progress := &progressTrackingWriter{opts: opts, total: totalSize}
+	tarWriter := tar.NewWriter(gzWriter)
+
+	archiveErr := writeTarArchive(tarWriter, sourcePath, destPath, progress)
+	tarWriter.Close()
+	gzWriter.Close()
+	stdin.Close()
+
+	waitErr := cmd.Wait()
+	<-stdoutDone
+	if archiveErr != nil {
+		return fmt.Errorf("error archiving %s for remote copy: %w", sourcePath, archiveErr)
+	}
+	if waitErr != nil {
+		return fmt.Errorf("remote extraction failed: %w", waitErr)
+	}
+
+	result := strings.TrimSpace(stdoutBuf.String())
+	if isDir {
+		if result != dirExtractSentinel {
+			return fmt.Errorf("remote extraction did not confirm success for %s: got %q", destPath, result)
+		}
+		return nil
+	}
+	if result != localSum {
+		return fmt.Errorf("integrity check failed copying %s to remote: local sha256 %s, remote reported %s", sourcePath, localSum, result)
+	}
+	return nil
+}
+
+// progressTrackingWriter forwards the raw (pre-tar, pre-gzip) file bytes
+// CpHostToRemote streams and reports cumulative bytes sent on
+// opts.Progress, if set.
+type progressTrackingWriter struct {
+	opts  *CpOpts
+	total int64
+	sent  int64
+}
+
+func (w *progressTrackingWriter) Write(p []byte) (int, error) {
+	w.sent += int64(len(p))
+	if w.opts.Progress != nil {
+		w.opts.Progress <- CpProgress{BytesSent: w.sent, BytesTotal: w.total}
+	}
+	return len(p), nil
+}
+
+// writeTarArchive walks sourcePath (file or directory) and writes it into
+// tw, rooted at filepath.Base(destPath) rather than sourcePath's own
+// basename. The remote bootstrap extracts into filepath.Dir(destPath) and
+// then operates on destPath itself, so the archive's root entry name has
+// to match destPath's basename or the extracted file lands somewhere
+// other than destPath. progress, if non-nil, is written to as each file's
+// raw content is copied into the archive.
+func writeTarArchive(tw *tar.Writer, sourcePath string, destPath string, progress io.Writer) error {
+	info, err := os.Stat(sourcePath)
+	if err != nil {
+		return err
+	}
+
+	base := filepath.Base(destPath)
+
+	if !info.IsDir() {
+		return addFileToTar(tw, sourcePath, base, info, progress)
+	}
+
+	return filepath.Walk(sourcePath, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(sourcePath, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(base, rel))
+		if fi.IsDir() {
+			hdr, err := tar.FileInfoHeader(fi, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = name + "/"
+			return tw.WriteHeader(hdr)
+		}
+		return addFileToTar(tw, path, name, fi, progress)
+	})
+}
+
+func addFileToTar(tw *tar.Writer, path string, name string, info os.FileInfo, progress io.Writer) error {
+	hdr, err := tar.FileInfoHeader(info, "")
+	if err != nil {
+		return err
+	}
+	hdr.Name = name
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dst := io.Writer(tw)
+	if progress != nil {
+		dst = io.MultiWriter(tw, progress)
+	}
+	_, err = io.Copy(dst, f)
+	return err
+}
+
+// hashFile computes the sha256 and size of a single file, matching exactly
+// what the remote's `sha256sum installPath` will compute once extracted.
+func hashFile(path string) (string, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	size, err := io.Copy(hash, f)
+	if err != nil {
+		return "", 0, err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// dirSize sums the size of every regular file under root, for progress
+// reporting on directory copies (which skip the sha256 integrity check).
+func dirSize(root string) (int64, error) {
+	var total int64
+	err := filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !fi.IsDir() {
+			total += fi.Size()
+		}
+		return nil
+	})
+	return total, err
+}
+
+// renderAndRun executes tmplRaw against words on the remote shell and
+// returns its trimmed output.
+func renderAndRun(ctx context.Context, client distroRunner, tmplRaw string, words map[string]string) (string, error) {
+	buf := &bytes.Buffer{}
+	tmpl := template.Must(template.New("").Parse(tmplRaw))
+	if err := tmpl.Execute(buf, words); err != nil {
+		return "", err
+	}
+	cmd := client.WslCommand(ctx, buf.String())
+	out, err := cmd.Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
@@ -0,0 +1,268 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wsl
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeCmd is a fake wslCmd that captures whatever is written to its stdin
+// and lets a test supply the remote-side behavior via waitFn.
+type fakeCmd struct {
+	cmdStr  string
+	stdin   bytes.Buffer
+	stdoutR *io.PipeReader
+	stdoutW *io.PipeWriter
+	waitFn  func(stdin []byte) (stdout string, err error)
+	output  []byte
+	outErr  error
+}
+
+func (c *fakeCmd) StdinPipe() (io.WriteCloser, error) {
+	return nopWriteCloser{&c.stdin}, nil
+}
+
+func (c *fakeCmd) StdoutPipe() (io.ReadCloser, error) {
+	c.stdoutR, c.stdoutW = io.Pipe()
+	return c.stdoutR, nil
+}
+
+func (c *fakeCmd) Start() error { return nil }
+
+func (c *fakeCmd) Wait() error {
+	out, err := c.waitFn(c.stdin.Bytes())
+	c.stdoutW.Write([]byte(out))
+	c.stdoutW.Close()
+	return err
+}
+
+func (c *fakeCmd) Output() ([]byte, error) {
+	return c.output, c.outErr
+}
+
+type nopWriteCloser struct{ w io.Writer }
+
+func (n nopWriteCloser) Write(p []byte) (int, error) { return n.w.Write(p) }
+func (n nopWriteCloser) Close() error                { return nil }
+
+// fakeDistro is a fake distroRunner. gen is called once per WslCommand
+// invocation and decides how that command behaves; every generated cmdStr
+// is recorded in cmds for assertions.
+type fakeDistro struct {
+	cmds []string
+	gen  func(cmdStr string) *fakeCmd
+}
+
+func (d *fakeDistro) WslCommand(ctx context.Context, cmdStr string) wslCmd {
+	d.cmds = append(d.cmds, cmdStr)
+	return d.gen(cmdStr)
+}
+
+func readTarEntry(archive []byte, name string) ([]byte, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil, fmt.Errorf("entry %q not found in archive", name)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Name == name {
+			return io.ReadAll(tr)
+		}
+	}
+}
+
+func tarEntryNames(archive []byte) ([]string, error) {
+	gz, err := gzip.NewReader(bytes.NewReader(archive))
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+	var names []string
+	tr := tar.NewReader(gz)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return names, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, hdr.Name)
+	}
+}
+
+func TestCpHostToRemoteFile(t *testing.T) {
+	srcDir := t.TempDir()
+	srcPath := filepath.Join(srcDir, "wsh-linux-amd64")
+	content := []byte("pretend wsh binary contents")
+	if err := os.WriteFile(srcPath, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	destPath := "/home/user/.waveterm/bin/wsh"
+
+	distro := &fakeDistro{
+		gen: func(cmdStr string) *fakeCmd {
+			return &fakeCmd{
+				cmdStr: cmdStr,
+				waitFn: func(stdin []byte) (string, error) {
+					data, err := readTarEntry(stdin, "wsh")
+					if err != nil {
+						return "", err
+					}
+					sum := sha256.Sum256(data)
+					return hex.EncodeToString(sum[:]) + "\n", nil
+				},
+			}
+		},
+	}
+
+	progressChan := make(chan CpProgress, 16)
+	var progress []CpProgress
+	progressDone := make(chan struct{})
+	go func() {
+		for p := range progressChan {
+			progress = append(progress, p)
+		}
+		close(progressDone)
+	}()
+
+	err := CpHostToRemote(context.Background(), distro, srcPath, destPath, &CpOpts{Progress: progressChan})
+	<-progressDone
+	if err != nil {
+		t.Fatalf("CpHostToRemote: %v", err)
+	}
+
+	if len(distro.cmds) != 1 {
+		t.Fatalf("expected exactly one remote command, got %d: %v", len(distro.cmds), distro.cmds)
+	}
+	gotCmd := distro.cmds[0]
+	if !strings.Contains(gotCmd, "mkdir -p") || !strings.Contains(gotCmd, "/home/user/.waveterm/bin") {
+		t.Errorf("extract command doesn't reference the install dir: %q", gotCmd)
+	}
+
+	if len(progress) == 0 || progress[len(progress)-1].BytesSent != int64(len(content)) {
+		t.Errorf("expected final progress BytesSent=%d, got %+v", len(content), progress)
+	}
+}
+
+func TestCpHostToRemoteDir(t *testing.T) {
+	srcDir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(srcDir, "sub"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "a.txt"), []byte("aaa"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(srcDir, "sub", "b.txt"), []byte("bb"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	destPath := "/home/user/.waveterm/extdir"
+
+	var gotNames []string
+	distro := &fakeDistro{
+		gen: func(cmdStr string) *fakeCmd {
+			return &fakeCmd{
+				cmdStr: cmdStr,
+				waitFn: func(stdin []byte) (string, error) {
+					var err error
+					gotNames, err = tarEntryNames(stdin)
+					if err != nil {
+						return "", err
+					}
+					return dirExtractSentinel + "\n", nil
+				},
+			}
+		},
+	}
+
+	if err := CpHostToRemote(context.Background(), distro, srcDir, destPath, nil); err != nil {
+		t.Fatalf("CpHostToRemote: %v", err)
+	}
+
+	want := []string{"extdir/", "extdir/a.txt", "extdir/sub/", "extdir/sub/b.txt"}
+	if len(gotNames) != len(want) {
+		t.Fatalf("tar entries = %v, want %v", gotNames, want)
+	}
+	for i, name := range want {
+		if gotNames[i] != name {
+			t.Errorf("tar entry %d = %q, want %q", i, gotNames[i], name)
+		}
+	}
+}
+
+func TestCpHostToRemoteResumeSkipsMatchingFile(t *testing.T) {
+	srcDir := t.TempDir()
+	srcPath := filepath.Join(srcDir, "wsh")
+	content := []byte("same bytes on both sides")
+	if err := os.WriteFile(srcPath, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(content)
+	localSum := hex.EncodeToString(sum[:])
+
+	distro := &fakeDistro{
+		gen: func(cmdStr string) *fakeCmd {
+			return &fakeCmd{cmdStr: cmdStr, output: []byte(localSum + "\n")}
+		},
+	}
+
+	err := CpHostToRemote(context.Background(), distro, srcPath, "/home/user/.waveterm/bin/wsh", &CpOpts{Resume: true})
+	if err != nil {
+		t.Fatalf("CpHostToRemote: %v", err)
+	}
+	if len(distro.cmds) != 1 {
+		t.Fatalf("expected only the resume sha256 probe to run, got %d commands: %v", len(distro.cmds), distro.cmds)
+	}
+	if !strings.Contains(distro.cmds[0], "sha256sum") {
+		t.Errorf("expected the single command to be the sha256 probe, got %q", distro.cmds[0])
+	}
+}
+
+func TestCpHostToRemoteIntegrityMismatch(t *testing.T) {
+	srcDir := t.TempDir()
+	srcPath := filepath.Join(srcDir, "wsh")
+	if err := os.WriteFile(srcPath, []byte("local bytes"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	distro := &fakeDistro{
+		gen: func(cmdStr string) *fakeCmd {
+			return &fakeCmd{
+				cmdStr: cmdStr,
+				waitFn: func(stdin []byte) (string, error) {
+					return "deadbeef\n", nil
+				},
+			}
+		},
+	}
+
+	err := CpHostToRemote(context.Background(), distro, srcPath, "/home/user/.waveterm/bin/wsh", nil)
+	if err == nil {
+		t.Fatal("expected an integrity check error, got nil")
+	}
+	if !strings.Contains(err.Error(), "integrity check failed") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+// Copyright 2024, Command Line Inc.
+// SPDX-License-Identifier: Apache-2.0
+
+package wsl
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+)
+
+//go:embed wsh-manifest.json
+var wshManifestRaw []byte
+
+// wshManifestEntry describes where to find the wsh binary for a given
+// "os/arch" pair and which version it ships, so ProvisionWsh can decide
+// whether a remote's existing wsh needs replacing.
+type wshManifestEntry struct {
+	Path    string `json:"path"`
+	Version string `json:"version"`
+}
+
+var wshManifest map[string]wshManifestEntry
+
+func init() {
+	wshManifest = make(map[string]wshManifestEntry)
+	if err := json.Unmarshal(wshManifestRaw, &wshManifest); err != nil {
+		log.Printf("wsl: unable to parse embedded wsh manifest: %s", err)
+	}
+}
+
+// DistroCapabilities caches the per-distro facts ProvisionWsh needs to
+// decide how to install wsh, so reconnecting to the same distro doesn't
+// re-run the same probe commands every time.
+type DistroCapabilities struct {
+	Os      string
+	Arch    string
+	HasBash bool
+}
+
+var distroCapCache sync.Map // distro name -> *DistroCapabilities
+
+// getDistroCapabilities probes and caches the facts needed to provision a
+// distro. Pass forceRefresh to bypass the cache, e.g. after a distro is
+// known to have changed underneath us.
+func getDistroCapabilities(ctx context.Context, client *Distro, forceRefresh bool) (*DistroCapabilities, error) {
+	if !forceRefresh {
+		if cached, ok := distroCapCache.Load(client.Name); ok {
+			return cached.(*DistroCapabilities), nil
+		}
+	}
+
+	osName, err := GetClientOs(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine remote os: %w", err)
+	}
+	arch, err := GetClientArch(ctx, client)
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine remote arch: %w", err)
+	}
+	hasBash, err := hasBashInstalled(ctx, client)
+	if err != nil {
+		return nil, err
+	}
+
+	caps := &DistroCapabilities{Os: osName, Arch: arch, HasBash: hasBash}
+	distroCapCache.Store(client.Name, caps)
+	return caps, nil
+}
+
+// ProvisionOpts lets callers observe and tweak a ProvisionWsh run. The UI
+// uses the hooks to show progress; tests and scripted reconnects can set
+// ForceReinstall to skip the version check.
+type ProvisionOpts struct {
+	// OnPreInstall fires right before a wsh binary is streamed to the remote.
+	OnPreInstall func(client *Distro, caps *DistroCapabilities)
+	// OnPostInstall fires after install (or the attempt to install) completes.
+	OnPostInstall func(client *Distro, err error)
+	// Progress is forwarded to CpHostToRemote's CpOpts.Progress, if set.
+	Progress chan<- CpProgress
+	// ForceReinstall skips the installed-version check and always reinstalls.
+	ForceReinstall bool
+}
+
+// ProvisionWsh makes sure client has a working, up-to-date wsh installed,
+// installing or upgrading it if necessary. It is idempotent and cheap to
+// call at connection time: if wsh is already at the manifest version, it
+// only pays for a version check and a shell round trip.
+func ProvisionWsh(ctx context.Context, client *Distro, opts *ProvisionOpts) error {
+	if opts == nil {
+		opts = &ProvisionOpts{}
+	}
+
+	caps, err := getDistroCapabilities(ctx, client, opts.ForceReinstall)
+	if err != nil {
+		return err
+	}
+
+	// GetClientArch reports uname -m style names (with x86_64 as x64);
+	// the manifest is keyed by Go-style arch names
+	arch := caps.Arch
+	switch arch {
+	case "x64":
+		arch = "amd64"
+	case "aarch64":
+		arch = "arm64"
+	}
+	manifestKey := caps.Os + "/" + arch
+	entry, ok := wshManifest[manifestKey]
+	if !ok {
+		return fmt.Errorf("no wsh binary available for %s", manifestKey)
+	}
+
+	needsInstall := opts.ForceReinstall
+	if !needsInstall {
+		installedVersion, err := GetWshVersion(ctx, client)
+		if err != nil || installedVersion != entry.Version {
+			needsInstall = true
+		}
+	}
+
+	if needsInstall {
+		if !caps.HasBash {
+			// CpHostToRemote's bootstrap scripts are bash/POSIX-only
+			// (command -v, mkdir -p, etc.); piping them into cmd.exe or
+			// PowerShell would just fail partway through, so refuse up
+			// front with a clear error instead of a confusing remote
+			// extraction failure.
+			return fmt.Errorf("wsh provisioning requires a bash-capable shell on %s; cmd.exe/PowerShell-only install is not yet supported", client.Name)
+		}
+
+		if opts.OnPreInstall != nil {
+			opts.OnPreInstall(client, caps)
+		}
+
+		destPath := GetWshPath(ctx, client)
+		cpOpts := &CpOpts{Progress: opts.Progress, Resume: !opts.ForceReinstall}
+		installErr := CpHostToRemote(ctx, client, entry.Path, destPath, cpOpts)
+		if installErr == nil {
+			installErr = InstallClientRcFiles(ctx, client)
+		}
+
+		if opts.OnPostInstall != nil {
+			opts.OnPostInstall(client, installErr)
+		}
+		if installErr != nil {
+			return fmt.Errorf("unable to provision wsh on %s: %w", client.Name, installErr)
+		}
+
+		// the binary changed, so the cached capabilities' probe results
+		// (e.g. whether bash is now reachable via the new rc files) may be stale
+		distroCapCache.Delete(client.Name)
+	}
+
+	return verifyWsh(ctx, client, entry.Version)
+}
+
+// verifyWsh confirms the installed wsh actually works. It runs
+// "wsh version" directly and checks both that the remote responded and
+// that the version matches the manifest version,
+// so a broken binary or a PATH pointing at a stale wsh is reported as a
+// provisioning failure instead of silently succeeding.
+func verifyWsh(ctx context.Context, client *Distro, wantVersion string) error {
+	path := GetWshPath(ctx, client)
+	cmd := client.WslCommand(ctx, path+" version")
+	out, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("wsh installed but did not respond to %q: %w", path+" version", err)
+	}
+	gotVersion := strings.TrimSpace(string(out))
+	if gotVersion == "" {
+		return fmt.Errorf("wsh installed but %q returned no output", path+" version")
+	}
+	if wantVersion != "" && gotVersion != wantVersion {
+		return fmt.Errorf("wsh installed but reports version %q, expected %q", gotVersion, wantVersion)
+	}
+	log.Printf("wsl: provisioned wsh %s on %s", gotVersion, client.Name)
+	return nil
+}